@@ -0,0 +1,137 @@
+package main
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// cacheEntry is a cached object body together with the metadata needed to
+// revalidate and to satisfy conditional GETs
+type cacheEntry struct {
+	body         []byte
+	etag         string
+	lastModified time.Time
+}
+
+// lruCache is a size- and byte-bounded, path-keyed LRU cache of cacheEntry
+type lruCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	curBytes   int64
+	order      *list.List
+	items      map[string]*list.Element
+}
+
+type lruCacheItem struct {
+	path  string
+	entry *cacheEntry
+}
+
+// newLRUCache builds a cache bounded by maxEntries and maxBytes of cached bodies
+func newLRUCache(maxEntries int, maxBytes int64) *lruCache {
+	return &lruCache{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached entry for path, promoting it to most-recently-used
+func (c *lruCache) get(path string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[path]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*lruCacheItem).entry, true
+}
+
+// set stores entry for path, evicting the least-recently-used entries as
+// needed to stay within maxEntries and maxBytes
+func (c *lruCache) set(path string, entry *cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[path]; ok {
+		c.curBytes -= int64(len(element.Value.(*lruCacheItem).entry.body))
+		element.Value.(*lruCacheItem).entry = entry
+		c.order.MoveToFront(element)
+		c.curBytes += int64(len(entry.body))
+	} else {
+		element := c.order.PushFront(&lruCacheItem{path: path, entry: entry})
+		c.items[path] = element
+		c.curBytes += int64(len(entry.body))
+	}
+
+	for (c.maxEntries > 0 && c.order.Len() > c.maxEntries) || (c.maxBytes > 0 && c.curBytes > c.maxBytes) {
+		oldest := c.order.Back()
+		if oldest == nil {
+			break
+		}
+		c.evict(oldest)
+	}
+}
+
+// remove drops path from the cache, e.g. after it is written or deleted
+func (c *lruCache) remove(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[path]; ok {
+		c.evict(element)
+	}
+}
+
+// evict must be called with c.mu held
+func (c *lruCache) evict(element *list.Element) {
+	item := element.Value.(*lruCacheItem)
+	c.curBytes -= int64(len(item.entry.body))
+	delete(c.items, item.path)
+	c.order.Remove(element)
+}
+
+// clientHasFreshCopy reports whether r's conditional headers show the
+// client already holds the current representation of the object
+func clientHasFreshCopy(r *http.Request, etag string, lastModified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return inm == "*" || inm == etag
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		if since, err := http.ParseTime(ims); err == nil {
+			return !lastModified.After(since)
+		}
+	}
+
+	return false
+}
+
+// writeNotModified answers a request with a bare 304, per RFC 7232
+func writeNotModified(w http.ResponseWriter, etag string, lastModified time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// writeCachedResponse serves a cache hit straight from memory
+func writeCachedResponse(w http.ResponseWriter, entry *cacheEntry) {
+	w.Header().Set("Accept-Ranges", "bytes")
+	if entry.etag != "" {
+		w.Header().Set("ETag", entry.etag)
+	}
+	if !entry.lastModified.IsZero() {
+		w.Header().Set("Last-Modified", entry.lastModified.UTC().Format(http.TimeFormat))
+	}
+	w.Write(entry.body)
+}
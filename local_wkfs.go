@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var localRoot string
+
+func init() {
+	RegisterBackend("local", newLocalFileSystem)
+}
+
+// localFileSystem is a FileSystem backed by a directory on local disk
+type localFileSystem struct {
+	root string
+}
+
+// Build the localFileSystem from the LOCAL_ROOT environment variable
+func newLocalFileSystem() (FileSystem, error) {
+	localRoot = getEnvOrDefault("LOCAL_ROOT", ".", false)
+	return &localFileSystem{root: localRoot}, nil
+}
+
+// Resolve a request path to a path under the backend's root (relative when
+// the root itself is relative, as with the default ".")
+func (fs *localFileSystem) resolve(path string) string {
+	return filepath.Join(fs.root, filepath.Clean("/"+path))
+}
+
+// Open a file on disk, honouring a "bytes=start-end" Range header if set
+func (fs *localFileSystem) Open(path string, rangeHeader string) (io.ReadCloser, *FileInfo, error) {
+	f, err := os.Open(fs.resolve(path))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	info := &FileInfo{LastModified: stat.ModTime(), ContentLength: stat.Size()}
+
+	if rangeHeader == "" {
+		return f, info, nil
+	}
+
+	start, end, err := parseRangeHeader(rangeHeader, stat.Size())
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	info.ContentLength = end - start + 1
+	info.ContentRange = fmt.Sprintf("bytes %d-%d/%d", start, end, stat.Size())
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, info.ContentLength), f}, info, nil
+}
+
+// Create a file on disk, replacing it if it already exists
+func (fs *localFileSystem) Create(path string, body io.Reader) (*FileInfo, error) {
+	full := fs.resolve(path)
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(full)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	size, err := io.Copy(f, body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileInfo{ContentLength: size, LastModified: time.Now()}, nil
+}
+
+// Remove a file on disk
+func (fs *localFileSystem) Remove(path string) error {
+	return os.Remove(fs.resolve(path))
+}
+
+// Stat a file on disk without opening it
+func (fs *localFileSystem) Stat(path string) (*FileInfo, error) {
+	stat, err := os.Stat(fs.resolve(path))
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{LastModified: stat.ModTime(), ContentLength: stat.Size()}, nil
+}
+
+// rangeNotSatisfiableError reports a Range request that falls entirely
+// outside an object of the given size, per RFC 7233 section 4.4
+type rangeNotSatisfiableError struct {
+	size int64
+}
+
+func (e *rangeNotSatisfiableError) Error() string {
+	return fmt.Sprintf("range not satisfiable against %d byte object", e.size)
+}
+
+// parseRangeHeader parses a single-range "bytes=start-end" HTTP Range header,
+// returning a *rangeNotSatisfiableError if the requested range is empty or
+// starts beyond the end of an object of the given size
+func parseRangeHeader(rangeHeader string, size int64) (start, end int64, err error) {
+	spec := strings.TrimPrefix(rangeHeader, "bytes=")
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range header %q", rangeHeader)
+	}
+
+	if parts[0] == "" {
+		// Suffix range: "bytes=-500" means the last 500 bytes
+		suffix, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = size - suffix
+		if start < 0 {
+			start = 0
+		}
+		end = size - 1
+	} else {
+		start, err = strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if parts[1] == "" {
+			end = size - 1
+		} else {
+			end, err = strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return 0, 0, err
+			}
+			if end > size-1 {
+				end = size - 1
+			}
+		}
+	}
+
+	if start < 0 || start >= size || start > end {
+		return 0, 0, &rangeNotSatisfiableError{size: size}
+	}
+
+	return start, end, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rest_s3_proxy_requests_total",
+		Help: "Total number of requests handled, by method and status",
+	}, []string{"method", "status"})
+
+	requestDurationSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "rest_s3_proxy_request_duration_seconds",
+		Help: "Request latency in seconds, by method",
+	}, []string{"method"})
+
+	requestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rest_s3_proxy_requests_in_flight",
+		Help: "Number of requests currently being served",
+	})
+
+	bytesInTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rest_s3_proxy_bytes_in_total",
+		Help: "Total bytes received from clients",
+	})
+
+	bytesOutTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "rest_s3_proxy_bytes_out_total",
+		Help: "Total bytes sent to clients",
+	})
+
+	s3ErrorsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "rest_s3_proxy_s3_errors_total",
+		Help: "Total backend errors, by S3 error code",
+	}, []string{"code"})
+
+	healthStatus = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "rest_s3_proxy_health_status",
+		Help: "Whether the last health check succeeded (1) or failed (0)",
+	})
+)
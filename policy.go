@@ -0,0 +1,184 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// PolicyRule grants the listed tokens access to the given methods under a
+// path prefix, e.g. restricting a tenant's token to PUT under /tenants/42/
+type PolicyRule struct {
+	Methods    []string `yaml:"methods" json:"methods"`
+	PathPrefix string   `yaml:"path_prefix" json:"path_prefix"`
+	Tokens     []string `yaml:"tokens" json:"tokens"`
+}
+
+// Policy is the ruleset loaded from POLICY_FILE
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules" json:"rules"`
+}
+
+// loadPolicy reads a YAML or JSON ruleset depending on the file's extension
+func loadPolicy(path string) (*Policy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy := &Policy{}
+	if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+		err = yaml.Unmarshal(data, policy)
+	} else {
+		err = json.Unmarshal(data, policy)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// authenticate extracts the calling subject from r, via a Bearer token, a
+// valid signed URL, or a client certificate presented over mTLS. preauthorized
+// is true when the credential already scopes the caller to this exact
+// method+path (a signed URL), so authorize() should not be consulted again
+func authenticate(r *http.Request) (subject string, preauthorized bool, err error) {
+	if authHeader := r.Header.Get("Authorization"); strings.HasPrefix(authHeader, "Bearer ") {
+		return strings.TrimPrefix(authHeader, "Bearer "), false, nil
+	}
+
+	if r.URL.Query().Get("signature") != "" {
+		if err := verifySignedURL(r); err != nil {
+			return "signed-url", false, err
+		}
+		return "signed-url", true, nil
+	}
+
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.CommonName, false, nil
+	}
+
+	return "", false, errors.New("no credentials provided")
+}
+
+// authorize checks subject against the loaded policy's rules for
+// method+path, defaulting to deny when nothing matches
+func authorize(method, path, subject string) bool {
+	if policy == nil {
+		return false
+	}
+
+	for _, rule := range policy.Rules {
+		if !strings.HasPrefix(path, rule.PathPrefix) {
+			continue
+		}
+		if !methodMatches(rule.Methods, method) {
+			continue
+		}
+		for _, token := range rule.Tokens {
+			if token == "*" || hmac.Equal([]byte(token), []byte(subject)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func methodMatches(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == "*" || strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// signURL mints a time-limited signed URL for method+path, valid until
+// expiry, by HMAC-SHA256 signing "method|path|expiry" with signingSecret
+func signURL(method, path string, expiry time.Time) string {
+	expiryUnix := strconv.FormatInt(expiry.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(method + "|" + path + "|" + expiryUnix))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	return "/" + path + "?expires=" + expiryUnix + "&signature=" + signature
+}
+
+// verifySignedURL checks the expires/signature query parameters a client
+// presents in lieu of an Authorization header
+func verifySignedURL(r *http.Request) error {
+	query := r.URL.Query()
+	expiresParam := query.Get("expires")
+	signature := query.Get("signature")
+	if expiresParam == "" || signature == "" {
+		return errors.New("missing expires or signature query parameter")
+	}
+
+	expiry, err := strconv.ParseInt(expiresParam, 10, 64)
+	if err != nil {
+		return errors.New("invalid expires query parameter")
+	}
+	if time.Now().Unix() > expiry {
+		return errors.New("signed URL has expired")
+	}
+
+	path := r.URL.Path[1:]
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte(r.Method + "|" + path + "|" + expiresParam))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("signature does not match")
+	}
+
+	return nil
+}
+
+// serveSignURL handles the "_sign" endpoint: an authenticated caller asks
+// for a short-lived download link for a path without being handed credentials
+func serveSignURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "/_sign is restricted to POST requests", http.StatusMethodNotAllowed)
+		return
+	}
+
+	subject, _, err := authenticate(r)
+	if err != nil {
+		http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	targetPath := r.URL.Query().Get("path")
+	if targetPath == "" {
+		http.Error(w, "path query parameter must be provided", http.StatusBadRequest)
+		return
+	}
+
+	if !authorize("GET", targetPath, subject) {
+		http.Error(w, "Forbidden: '"+subject+"' may not GET '"+targetPath+"'", http.StatusForbidden)
+		return
+	}
+
+	ttlSeconds := signedURLTTL
+	if raw := r.URL.Query().Get("ttl"); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			ttlSeconds = parsed
+		}
+	}
+
+	url := signURL("GET", targetPath, time.Now().Add(time.Duration(ttlSeconds)*time.Second))
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, url)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignURLRoundTrip(t *testing.T) {
+	signingSecret = "test-signing-secret"
+
+	expiry := time.Now().Add(5 * time.Minute)
+	signed := signURL("GET", "some/object.txt", expiry)
+
+	req := httptest.NewRequest("GET", signed, nil)
+	if err := verifySignedURL(req); err != nil {
+		t.Errorf("verifySignedURL() = %v, want nil", err)
+	}
+}
+
+func TestVerifySignedURLRejectsTamperedPath(t *testing.T) {
+	signingSecret = "test-signing-secret"
+
+	signed := signURL("GET", "some/object.txt", time.Now().Add(5*time.Minute))
+	req := httptest.NewRequest("GET", signed, nil)
+	req.URL.Path = "/some/other.txt"
+
+	if err := verifySignedURL(req); err == nil {
+		t.Error("expected verifySignedURL to reject a path that doesn't match the signature")
+	}
+}
+
+func TestVerifySignedURLRejectsExpired(t *testing.T) {
+	signingSecret = "test-signing-secret"
+
+	signed := signURL("GET", "some/object.txt", time.Now().Add(-time.Minute))
+	req := httptest.NewRequest("GET", signed, nil)
+
+	if err := verifySignedURL(req); err == nil {
+		t.Error("expected verifySignedURL to reject an expired signature")
+	}
+}
+
+func TestAuthenticatePreauthorizesValidSignedURL(t *testing.T) {
+	signingSecret = "test-signing-secret"
+
+	signed := signURL("GET", "some/object.txt", time.Now().Add(5*time.Minute))
+	req := httptest.NewRequest("GET", signed, nil)
+
+	subject, preauthorized, err := authenticate(req)
+	if err != nil {
+		t.Fatalf("authenticate() error = %v", err)
+	}
+	if !preauthorized {
+		t.Error("expected a valid signed URL to be preauthorized")
+	}
+	if subject == "" {
+		t.Error("expected a non-empty subject")
+	}
+}
+
+func TestAuthenticateBearerTokenIsNotPreauthorized(t *testing.T) {
+	req := httptest.NewRequest("GET", "/some/object.txt", nil)
+	req.Header.Set("Authorization", "Bearer my-token")
+
+	subject, preauthorized, err := authenticate(req)
+	if err != nil {
+		t.Fatalf("authenticate() error = %v", err)
+	}
+	if preauthorized {
+		t.Error("a Bearer token must still be checked against authorize()")
+	}
+	if subject != "my-token" {
+		t.Errorf("subject = %q, want %q", subject, "my-token")
+	}
+}
+
+func TestAuthorizeDefaultDeny(t *testing.T) {
+	policy = nil
+	if authorize("GET", "some/object.txt", "anyone") {
+		t.Error("expected authorize() to deny when no policy is loaded")
+	}
+
+	policy = &Policy{Rules: []PolicyRule{
+		{Methods: []string{"GET"}, PathPrefix: "some/", Tokens: []string{"alice"}},
+	}}
+	if authorize("GET", "some/object.txt", "bob") {
+		t.Error("expected authorize() to deny a token not listed for the rule")
+	}
+	if !authorize("GET", "some/object.txt", "alice") {
+		t.Error("expected authorize() to allow a token listed for the rule")
+	}
+	if authorize("PUT", "some/object.txt", "alice") {
+		t.Error("expected authorize() to deny a method not covered by the rule")
+	}
+}
@@ -5,8 +5,6 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"log"
 	"os"
 	"path/filepath"
 
@@ -18,16 +16,17 @@ import (
 	"net/http"
 
 	// AWS
-	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
+
+	// Logging and metrics
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
 )
 
 var (
 	// Loggers
-	infoLog  *log.Logger
-	errorLog *log.Logger
+	infoLog  *logrus.Logger
+	errorLog *logrus.Logger
 
 	// Health
 	healthFile               string
@@ -37,10 +36,33 @@ var (
 	// Web server
 	port string
 
-	// AWS settings
+	// AWS settings (used by the s3 backend)
 	awsRegion string
 	awsBucket string
-	s3Session *s3.S3
+
+	// Multipart upload settings (used by the s3 backend)
+	uploadPartSize    int64
+	uploadConcurrency int
+
+	// Backend
+	backendName string
+	fs          FileSystem
+
+	// S3 REST API compatibility mode
+	s3CompatMode         bool
+	proxyAccessKeyID     string
+	proxySecretAccessKey string
+
+	// Per-path authorization policy and signed URLs
+	policyEnabled bool
+	policy        *Policy
+	signingSecret string
+	signedURLTTL  int64
+
+	// In-process response cache
+	cacheEnabled       bool
+	cacheMaxEntryBytes int64
+	responseCache      *lruCache
 
 	// CommitHash contains the current Git revision. Use make to build to make
 	// sure this gets set.
@@ -54,14 +76,14 @@ func getEnvOrDefault(envName, defaultVal string, fatal bool) (envVal string) {
 	envVal = os.Getenv(envName)
 	if len(envVal) == 0 {
 		if fatal {
-			errorLog.Println(fmt.Sprintf("Unable to start as required env %s is not defined", envName))
+			errorLog.Errorf("Unable to start as required env %s is not defined", envName)
 			os.Exit(1)
 		}
 		envVal = defaultVal
-		infoLog.Println(fmt.Sprintf("Using default %s: %s", envName, envVal))
+		infoLog.Infof("Using default %s: %s", envName, envVal)
 	} else {
 		if envName != "AWS_ACCESS_KEY_ID" && envName != "AWS_SECRET_ACCESS_KEY" {
-			infoLog.Println(fmt.Sprintf("%s: %s", envName, envVal))
+			infoLog.Infof("%s: %s", envName, envVal)
 		}
 	}
 	return
@@ -72,11 +94,16 @@ func getAllEnvVariables() {
 	// Get the port that this webserver will be running upon
 	port = getEnvOrDefault("PORT", "8000", false)
 
-	// Get the AWS credentials
-	awsRegion = getEnvOrDefault("AWS_REGION", "eu-west-1", false)
-	awsBucket = getEnvOrDefault("AWS_BUCKET", "", true)
-	getEnvOrDefault("AWS_ACCESS_KEY_ID", "", true)
-	getEnvOrDefault("AWS_SECRET_ACCESS_KEY", "", true)
+	// Get the backend to serve files from
+	backendName = getEnvOrDefault("BACKEND", "s3", false)
+
+	// The s3 backend additionally needs AWS credentials
+	if backendName == "s3" {
+		awsRegion = getEnvOrDefault("AWS_REGION", "eu-west-1", false)
+		awsBucket = getEnvOrDefault("AWS_BUCKET", "", true)
+		getEnvOrDefault("AWS_ACCESS_KEY_ID", "", true)
+		getEnvOrDefault("AWS_SECRET_ACCESS_KEY", "", true)
+	}
 
 	// Get the path for the healthFile and the time to cache
 	healthFile = getEnvOrDefault("HEALTH_FILE", ".rest-s3-proxy", false)
@@ -88,6 +115,74 @@ func getAllEnvVariables() {
 		panic(err)
 	}
 	healthCheckCacheInterval = healthIntervalInt
+
+	// Get the multipart upload part size (in MB) and concurrency
+	uploadPartSizeString := getEnvOrDefault("UPLOAD_PART_SIZE_MB", "5", false)
+	uploadPartSizeInt, err := strconv.ParseInt(uploadPartSizeString, 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	uploadPartSize = uploadPartSizeInt * 1024 * 1024
+
+	uploadConcurrencyString := getEnvOrDefault("UPLOAD_CONCURRENCY", "5", false)
+	uploadConcurrencyInt, err := strconv.ParseInt(uploadConcurrencyString, 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	uploadConcurrency = int(uploadConcurrencyInt)
+
+	// Get whether to run in S3-compatible mode (SigV4 auth, XML responses)
+	s3CompatMode = getEnvOrDefault("S3_COMPAT_MODE", "false", false) == "true"
+	if s3CompatMode {
+		proxyAccessKeyID = getEnvOrDefault("PROXY_ACCESS_KEY_ID", "", true)
+		proxySecretAccessKey = getEnvOrDefault("PROXY_SECRET_ACCESS_KEY", "", true)
+	}
+
+	// Get the per-path authorization policy, if one has been configured
+	policyFile := getEnvOrDefault("POLICY_FILE", "", false)
+	policyEnabled = policyFile != ""
+	if policyEnabled {
+		signingSecret = getEnvOrDefault("SIGNING_SECRET", "", true)
+
+		signedURLTTLString := getEnvOrDefault("SIGNED_URL_TTL", "300", false)
+		signedURLTTLInt, err := strconv.ParseInt(signedURLTTLString, 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		signedURLTTL = signedURLTTLInt
+
+		loadedPolicy, err := loadPolicy(policyFile)
+		if err != nil {
+			errorLog.Errorf("Unable to load policy file %s: %s", policyFile, err)
+			os.Exit(1)
+		}
+		policy = loadedPolicy
+	}
+
+	// Get the in-process response cache settings, if caching is enabled
+	cacheEnabled = getEnvOrDefault("CACHE_ENABLED", "false", false) == "true"
+	if cacheEnabled {
+		cacheMaxEntriesString := getEnvOrDefault("CACHE_MAX_ENTRIES", "1000", false)
+		cacheMaxEntriesInt, err := strconv.ParseInt(cacheMaxEntriesString, 10, 64)
+		if err != nil {
+			panic(err)
+		}
+
+		cacheMaxBytesString := getEnvOrDefault("CACHE_MAX_BYTES", "104857600", false)
+		cacheMaxBytesInt, err := strconv.ParseInt(cacheMaxBytesString, 10, 64)
+		if err != nil {
+			panic(err)
+		}
+
+		cacheMaxEntryBytesString := getEnvOrDefault("CACHE_MAX_ENTRY_BYTES", "10485760", false)
+		cacheMaxEntryBytesInt, err := strconv.ParseInt(cacheMaxEntryBytesString, 10, 64)
+		if err != nil {
+			panic(err)
+		}
+		cacheMaxEntryBytes = cacheMaxEntryBytesInt
+
+		responseCache = newLRUCache(int(cacheMaxEntriesInt), cacheMaxBytesInt)
+	}
 }
 
 // Serve a request for a S3 file
@@ -95,6 +190,15 @@ func serveS3File(w http.ResponseWriter, r *http.Request) {
 	var method = r.Method
 	var path = r.URL.Path[1:] // Remove the / from the start of the URL
 
+	// A bucket-level ListObjectsV2 request has no path of its own
+	if path == "" && method == "GET" && r.URL.Query().Get("list-type") == "2" {
+		if !authorizeRequest("GET", "", w, r) {
+			return
+		}
+		serveListObjectsV2(w, r)
+		return
+	}
+
 	// A file with no path cannot be served
 	if path == "" {
 		http.Error(w, "Path must be provided", http.StatusBadRequest)
@@ -111,7 +215,15 @@ func serveS3File(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	infoLog.Println("Handling " + method + " request for '" + path + "'")
+	// Mint a short-lived signed download URL in lieu of proxying credentials
+	if path == "_sign" {
+		serveSignURL(w, r)
+		return
+	}
+
+	if !authorizeRequest(method, path, w, r) {
+		return
+	}
 
 	switch method {
 	case "GET":
@@ -125,55 +237,162 @@ func serveS3File(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// authorizeRequest enforces whichever auth layer is active for method+path,
+// writing an error response and returning false if the request may not proceed.
+// The policy layer takes precedence over S3 compatibility mode's SigV4 check;
+// with neither configured every request is allowed, preserving prior behaviour
+func authorizeRequest(method, path string, w http.ResponseWriter, r *http.Request) bool {
+	if policyEnabled {
+		subject, preauthorized, err := authenticate(r)
+		if err != nil {
+			http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+			return false
+		}
+		if preauthorized {
+			return true
+		}
+		if !authorize(method, path, subject) {
+			http.Error(w, "Forbidden: '"+subject+"' may not "+method+" '"+path+"'", http.StatusForbidden)
+			return false
+		}
+		return true
+	}
+
+	if s3CompatMode {
+		if err := verifySigV4(r); err != nil {
+			writeS3Error(w, http.StatusForbidden, "SignatureDoesNotMatch", err.Error(), "/"+path)
+			return false
+		}
+	}
+
+	return true
+}
+
 // Serve a health request
 func serveHealth(w http.ResponseWriter, r *http.Request) {
 	// Ensure that we can connect to the S3 bucket provided (every 10 seconds max)
 	currentTime := time.Now().Unix()
 
 	if (currentTime - lastHealthCheckTime) > healthCheckCacheInterval {
-		infoLog.Println("Making health check for path '" + healthFile + "'")
+		infoLog.Infof("Making health check for path '%s'", healthFile)
 
 		// Check that we have read permissions on the status file (we may not have listing permissions)
-		params := &s3.GetObjectInput{Bucket: aws.String(awsBucket), Key: aws.String(healthFile)}
-		_, err := s3Session.GetObject(params)
+		_, err := fs.Stat(healthFile)
 
 		if handleHTTPException(healthFile, w, err) != nil {
-			errorLog.Println("Health check failed")
+			errorLog.Error("Health check failed")
+			healthStatus.Set(0)
 			return
 		}
 
-		infoLog.Println("Health check passed")
+		infoLog.Info("Health check passed")
+		healthStatus.Set(1)
 		lastHealthCheckTime = currentTime
 	}
 	io.WriteString(w, "OK")
 }
 
-// Serve a GET request for a S3 file
+// Serve a GET request for a backend file, forwarding any Range header so
+// clients can resume interrupted downloads and stream large objects in chunks.
+// Whole-object (non-Range) responses are served from the in-process cache
+// when enabled. On every hit the cached ETag is revalidated with backends
+// that implement ConditionalStater; with other backends (e.g. local) a hit
+// is served from memory without asking the backend
 func serveGetS3File(filePath string, w http.ResponseWriter, r *http.Request) {
-	params := &s3.GetObjectInput{Bucket: aws.String(awsBucket), Key: aws.String(filePath)}
-	resp, err := s3Session.GetObject(params)
+	rangeHeader := r.Header.Get("Range")
+
+	if cacheEnabled && rangeHeader == "" {
+		if entry, ok := responseCache.get(filePath); ok {
+			if stater, ok := fs.(ConditionalStater); ok {
+				_, notModified, err := stater.StatIfNoneMatch(filePath, entry.etag)
+				if handleHTTPException(filePath, w, err) != nil {
+					return
+				}
+				if !notModified {
+					// The backend has a newer version; fall through to fetch it
+					responseCache.remove(filePath)
+				} else {
+					if clientHasFreshCopy(r, entry.etag, entry.lastModified) {
+						writeNotModified(w, entry.etag, entry.lastModified)
+						return
+					}
+					writeCachedResponse(w, entry)
+					return
+				}
+			} else {
+				if clientHasFreshCopy(r, entry.etag, entry.lastModified) {
+					writeNotModified(w, entry.etag, entry.lastModified)
+					return
+				}
+				writeCachedResponse(w, entry)
+				return
+			}
+		}
+	}
+
+	body, info, err := fs.Open(filePath, rangeHeader)
 
 	if handleHTTPException(filePath, w, err) != nil {
 		return
 	}
+	defer body.Close()
+
+	if rangeHeader == "" && clientHasFreshCopy(r, info.ETag, info.LastModified) {
+		writeNotModified(w, info.ETag, info.LastModified)
+		return
+	}
 
-	// File is ready to download
-	io.Copy(w, resp.Body)
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	if info.ETag != "" {
+		w.Header().Set("ETag", info.ETag)
+	}
+	if !info.LastModified.IsZero() {
+		w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if info.ContentRange != "" {
+		w.Header().Set("Content-Range", info.ContentRange)
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(info.ContentLength, 10))
+
+	if info.ContentRange != "" {
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	// File is ready to download, streamed directly from the backend to the client
+	if cacheEnabled && rangeHeader == "" && info.ContentLength > 0 && info.ContentLength <= cacheMaxEntryBytes {
+		var buf bytes.Buffer
+		copied, err := io.Copy(io.MultiWriter(w, &buf), body)
+		if err != nil || copied != info.ContentLength {
+			// The body was truncated partway through; don't cache a partial copy
+			responseCache.remove(filePath)
+			return
+		}
+		responseCache.set(filePath, &cacheEntry{body: buf.Bytes(), etag: info.ETag, lastModified: info.LastModified})
+		return
+	}
+
+	io.Copy(w, body)
 }
 
-// Serve a PUT request for a S3 file
+// Serve a PUT request for a backend file, streaming the request body
+// straight into the backend so large files don't have to be buffered in memory
 func servePutS3File(filePath string, w http.ResponseWriter, r *http.Request) {
-	// Convert the uploaded body to a byte array TODO fix this for large sizes
-	b, err := ioutil.ReadAll(r.Body)
+	info, err := fs.Create(filePath, r.Body)
 
 	if handleHTTPException(filePath, w, err) != nil {
 		return
 	}
 
-	params := &s3.PutObjectInput{Bucket: aws.String(awsBucket), Key: aws.String(filePath), Body: bytes.NewReader(b)}
-	_, err = s3Session.PutObject(params)
+	if cacheEnabled {
+		responseCache.remove(filePath)
+	}
 
-	if handleHTTPException(filePath, w, err) != nil {
+	if s3CompatMode {
+		if info != nil && info.ETag != "" {
+			w.Header().Set("ETag", info.ETag)
+		}
+		w.WriteHeader(http.StatusOK)
 		return
 	}
 
@@ -181,53 +400,142 @@ func servePutS3File(filePath string, w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/"+filePath, http.StatusCreated)
 }
 
-// Serve a DELETE request for a S3 file
+// Serve a DELETE request for a backend file
 func serveDeleteS3File(filePath string, w http.ResponseWriter, r *http.Request) {
-	params := &s3.DeleteObjectInput{Bucket: aws.String(awsBucket), Key: aws.String(filePath)}
-	_, err := s3Session.DeleteObject(params)
+	err := fs.Remove(filePath)
 
 	if handleHTTPException(filePath, w, err) != nil {
 		return
 	}
 
+	if cacheEnabled {
+		responseCache.remove(filePath)
+	}
+
 	// File has been deleted
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Handle an exception and write to response
+// Handle an exception and write to response, as a plain text body normally
+// or as S3-shaped XML when running in S3 compatibility mode
 func handleHTTPException(path string, w http.ResponseWriter, err error) (e error) {
-	if err != nil {
-		if awsError, ok := err.(awserr.Error); ok {
-			// aws error
-			switch awsError.Code() {
-			case "NoSuchKey":
-				http.Error(w, "Path '"+path+"' not found: "+awsError.Message(), http.StatusNotFound)
-			default:
-				origErr := awsError.OrigErr()
-				cause := ""
-				if origErr != nil {
-					cause = " (Cause: " + origErr.Error() + ")"
-				}
-				http.Error(w, "An internal error occurred: "+awsError.Code()+" = "+awsError.Message()+cause, http.StatusInternalServerError)
+	if err == nil {
+		return nil
+	}
+
+	if rangeErr, ok := err.(*rangeNotSatisfiableError); ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", rangeErr.size))
+	}
+
+	code, status, message := classifyError(path, err)
+	s3ErrorsTotal.WithLabelValues(code).Inc()
+
+	if s3CompatMode {
+		writeS3Error(w, status, code, message, "/"+path)
+	} else {
+		http.Error(w, message, status)
+	}
+
+	return err
+}
+
+// Classify a backend error into a S3 error code, HTTP status and message
+func classifyError(path string, err error) (code string, status int, message string) {
+	if rangeErr, ok := err.(*rangeNotSatisfiableError); ok {
+		return "InvalidRange", http.StatusRequestedRangeNotSatisfiable, rangeErr.Error()
+	}
+
+	if awsError, ok := err.(awserr.Error); ok {
+		switch awsError.Code() {
+		case "NoSuchKey":
+			return "NoSuchKey", http.StatusNotFound, "Path '" + path + "' not found: " + awsError.Message()
+		case "InvalidRange":
+			return "InvalidRange", http.StatusRequestedRangeNotSatisfiable, awsError.Message()
+		default:
+			origErr := awsError.OrigErr()
+			cause := ""
+			if origErr != nil {
+				cause = " (Cause: " + origErr.Error() + ")"
 			}
-		} else {
-			// golang error
-			http.Error(w, "An internal error occurred: "+err.Error(), http.StatusInternalServerError)
+			return awsError.Code(), http.StatusInternalServerError, "An internal error occurred: " + awsError.Code() + " = " + awsError.Message() + cause
 		}
 	}
-	return err
+
+	if os.IsNotExist(err) {
+		// backend reports the path doesn't exist (e.g. the local backend)
+		return "NoSuchKey", http.StatusNotFound, "Path '" + path + "' not found: " + err.Error()
+	}
+
+	return "InternalError", http.StatusInternalServerError, "An internal error occurred: " + err.Error()
 }
 
-// Initialise loggers
+// Initialise loggers, each emitting structured JSON lines to its own stream
 func initLogging(infoHandle io.Writer, errorHandle io.Writer) {
-	infoLog = log.New(infoHandle, "INFO: ", log.Ldate|log.Ltime|log.Lshortfile)
-	errorLog = log.New(errorHandle, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
+	infoLog = logrus.New()
+	infoLog.SetOutput(infoHandle)
+	infoLog.SetFormatter(&logrus.JSONFormatter{})
+
+	errorLog = logrus.New()
+	errorLog.SetOutput(errorHandle)
+	errorLog.SetFormatter(&logrus.JSONFormatter{})
+}
+
+// statusRecorder wraps a ResponseWriter to capture the status and byte
+// count of a response for metrics and logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// loggingMiddleware records Prometheus metrics and emits one structured
+// JSON log line per request, with the fields required for observability
+// under Kubernetes/Prometheus/Grafana
+func loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		requestsInFlight.Inc()
+		defer requestsInFlight.Dec()
+
+		if r.ContentLength > 0 {
+			bytesInTotal.Add(float64(r.ContentLength))
+		}
+
+		next(rec, r)
+
+		duration := time.Since(start)
+		bytesOutTotal.Add(float64(rec.bytes))
+		requestsTotal.WithLabelValues(r.Method, strconv.Itoa(rec.status)).Inc()
+		requestDurationSeconds.WithLabelValues(r.Method).Observe(duration.Seconds())
+
+		infoLog.WithFields(logrus.Fields{
+			"request_id":  newRequestID(),
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"duration_ms": duration.Milliseconds(),
+			"bytes":       rec.bytes,
+		}).Info("request handled")
+	}
 }
 
 // Main method
 func main() {
 	initLogging(os.Stdout, os.Stderr)
-	infoLog.Println(fmt.Sprintf("%s: %s (%s)", filepath.Base(os.Args[0]), BuildDate, CommitHash))
+	infoLog.Infof("%s: %s (%s)", filepath.Base(os.Args[0]), BuildDate, CommitHash)
 
 	// Reset health check status
 	lastHealthCheckTime = 0
@@ -235,16 +543,22 @@ func main() {
 	// Set up all the environment variables
 	getAllEnvVariables()
 
-	// Set up the S3 connection
-	s3Session = s3.New(session.New(), &aws.Config{Region: aws.String(awsRegion)})
+	// Set up the backend that will serve files
+	var err error
+	fs, err = newFileSystem(backendName)
+	if err != nil {
+		errorLog.Error(err)
+		os.Exit(1)
+	}
 
-	infoLog.Println("Startup complete")
+	infoLog.Info("Startup complete")
 
 	// Run the webserver
-	http.HandleFunc("/", serveS3File)
-	err := http.ListenAndServe(":"+port, nil)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/", loggingMiddleware(serveS3File))
+	err = http.ListenAndServe(":"+port, nil)
 	if err != nil {
-		errorLog.Println("ListenAndServe: ", err)
+		errorLog.Error("ListenAndServe: ", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+func init() {
+	RegisterBackend("s3", newS3FileSystem)
+}
+
+// s3FileSystem is a FileSystem backed by an S3 bucket
+type s3FileSystem struct {
+	session  *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+}
+
+// Build the s3FileSystem from the AWS_* and UPLOAD_* environment variables
+func newS3FileSystem() (FileSystem, error) {
+	awsSession := session.New(&aws.Config{Region: aws.String(awsRegion)})
+
+	return &s3FileSystem{
+		session: s3.New(awsSession),
+		uploader: s3manager.NewUploader(awsSession, func(u *s3manager.Uploader) {
+			u.PartSize = uploadPartSize
+			u.Concurrency = uploadConcurrency
+		}),
+		bucket: awsBucket,
+	}, nil
+}
+
+// Open a S3 object, forwarding rangeHeader to s3.GetObjectInput.Range if set
+func (fs *s3FileSystem) Open(path string, rangeHeader string) (io.ReadCloser, *FileInfo, error) {
+	params := &s3.GetObjectInput{Bucket: aws.String(fs.bucket), Key: aws.String(path)}
+	if rangeHeader != "" {
+		params.Range = aws.String(rangeHeader)
+	}
+
+	resp, err := fs.session.GetObject(params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info := &FileInfo{}
+	if resp.ETag != nil {
+		info.ETag = *resp.ETag
+	}
+	if resp.LastModified != nil {
+		info.LastModified = *resp.LastModified
+	}
+	if resp.ContentLength != nil {
+		info.ContentLength = *resp.ContentLength
+	}
+	if resp.ContentRange != nil {
+		info.ContentRange = *resp.ContentRange
+	}
+
+	return resp.Body, info, nil
+}
+
+// Create a S3 object, streaming body through a multipart upload
+func (fs *s3FileSystem) Create(path string, body io.Reader) (*FileInfo, error) {
+	input := &s3manager.UploadInput{Bucket: aws.String(fs.bucket), Key: aws.String(path), Body: body}
+	output, err := fs.uploader.Upload(input)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{}
+	if output.ETag != nil {
+		info.ETag = *output.ETag
+	}
+
+	return info, nil
+}
+
+// List the objects under prefix, translating straight to s3.ListObjectsV2
+func (fs *s3FileSystem) List(prefix, delimiter, continuationToken string, maxKeys int64) (*ListResult, error) {
+	params := &s3.ListObjectsV2Input{Bucket: aws.String(fs.bucket)}
+	if prefix != "" {
+		params.Prefix = aws.String(prefix)
+	}
+	if delimiter != "" {
+		params.Delimiter = aws.String(delimiter)
+	}
+	if continuationToken != "" {
+		params.ContinuationToken = aws.String(continuationToken)
+	}
+	if maxKeys > 0 {
+		params.MaxKeys = aws.Int64(maxKeys)
+	}
+
+	resp, err := fs.session.ListObjectsV2(params)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ListResult{IsTruncated: aws.BoolValue(resp.IsTruncated)}
+	for _, obj := range resp.Contents {
+		entry := ListEntry{Key: aws.StringValue(obj.Key), Size: aws.Int64Value(obj.Size)}
+		if obj.ETag != nil {
+			entry.ETag = *obj.ETag
+		}
+		if obj.LastModified != nil {
+			entry.LastModified = *obj.LastModified
+		}
+		result.Contents = append(result.Contents, entry)
+	}
+	for _, commonPrefix := range resp.CommonPrefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, aws.StringValue(commonPrefix.Prefix))
+	}
+	if resp.NextContinuationToken != nil {
+		result.NextContinuationToken = *resp.NextContinuationToken
+	}
+
+	return result, nil
+}
+
+// Remove a S3 object
+func (fs *s3FileSystem) Remove(path string) error {
+	params := &s3.DeleteObjectInput{Bucket: aws.String(fs.bucket), Key: aws.String(path)}
+	_, err := fs.session.DeleteObject(params)
+	return err
+}
+
+// Stat a S3 object without downloading its body
+func (fs *s3FileSystem) Stat(path string) (*FileInfo, error) {
+	params := &s3.HeadObjectInput{Bucket: aws.String(fs.bucket), Key: aws.String(path)}
+	resp, err := fs.session.HeadObject(params)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &FileInfo{}
+	if resp.ETag != nil {
+		info.ETag = *resp.ETag
+	}
+	if resp.LastModified != nil {
+		info.LastModified = *resp.LastModified
+	}
+	if resp.ContentLength != nil {
+		info.ContentLength = *resp.ContentLength
+	}
+
+	return info, nil
+}
+
+// StatIfNoneMatch lets the response cache revalidate a cached ETag with a
+// conditional HeadObject instead of re-downloading the object
+func (fs *s3FileSystem) StatIfNoneMatch(path, etag string) (*FileInfo, bool, error) {
+	params := &s3.HeadObjectInput{Bucket: aws.String(fs.bucket), Key: aws.String(path), IfNoneMatch: aws.String(etag)}
+	resp, err := fs.session.HeadObject(params)
+	if err != nil {
+		if reqErr, ok := err.(awserr.RequestFailure); ok && reqErr.StatusCode() == http.StatusNotModified {
+			return nil, true, nil
+		}
+		return nil, false, err
+	}
+
+	info := &FileInfo{}
+	if resp.ETag != nil {
+		info.ETag = *resp.ETag
+	}
+	if resp.LastModified != nil {
+		info.LastModified = *resp.LastModified
+	}
+	if resp.ContentLength != nil {
+		info.ContentLength = *resp.ContentLength
+	}
+
+	return info, false, nil
+}
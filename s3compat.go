@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// s3Error is the XML error document shape S3 itself returns
+type s3Error struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+// s3ListBucketResult is the XML response shape for ListObjectsV2
+type s3ListBucketResult struct {
+	XMLName               xml.Name         `xml:"ListBucketResult"`
+	Name                  string           `xml:"Name"`
+	Prefix                string           `xml:"Prefix"`
+	Delimiter             string           `xml:"Delimiter,omitempty"`
+	MaxKeys               int64            `xml:"MaxKeys"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	ContinuationToken     string           `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string           `xml:"NextContinuationToken,omitempty"`
+	Contents              []s3Object       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes,omitempty"`
+}
+
+type s3Object struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+}
+
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// writeS3Error writes a S3-shaped XML error document with the given status
+func writeS3Error(w http.ResponseWriter, status int, code, message, resource string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+
+	xml.NewEncoder(w).Encode(s3Error{
+		Code:      code,
+		Message:   message,
+		Resource:  resource,
+		RequestID: newRequestID(),
+	})
+}
+
+// serveListObjectsV2 translates a ?list-type=2 bucket listing request into
+// a Lister.List call against the active backend
+func serveListObjectsV2(w http.ResponseWriter, r *http.Request) {
+	lister, ok := fs.(Lister)
+	if !ok {
+		writeS3Error(w, http.StatusNotImplemented, "NotImplemented", "This backend does not support ListObjectsV2", "/")
+		return
+	}
+
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	continuationToken := query.Get("continuation-token")
+
+	maxKeys := int64(1000)
+	if raw := query.Get("max-keys"); raw != "" {
+		if parsed, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			maxKeys = parsed
+		}
+	}
+
+	result, err := lister.List(prefix, delimiter, continuationToken, maxKeys)
+	if handleHTTPException(prefix, w, err) != nil {
+		return
+	}
+
+	body := s3ListBucketResult{
+		Name:                  awsBucket,
+		Prefix:                prefix,
+		Delimiter:             delimiter,
+		MaxKeys:               maxKeys,
+		IsTruncated:           result.IsTruncated,
+		ContinuationToken:     continuationToken,
+		NextContinuationToken: result.NextContinuationToken,
+	}
+	for _, entry := range result.Contents {
+		body.Contents = append(body.Contents, s3Object{
+			Key:          entry.Key,
+			LastModified: entry.LastModified.UTC().Format(time.RFC3339),
+			ETag:         entry.ETag,
+			Size:         entry.Size,
+		})
+	}
+	for _, commonPrefix := range result.CommonPrefixes {
+		body.CommonPrefixes = append(body.CommonPrefixes, s3CommonPrefix{Prefix: commonPrefix})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	xml.NewEncoder(w).Encode(body)
+}
+
+// newRequestID generates an opaque id to echo back in S3 error documents
+func newRequestID() string {
+	return strconv.FormatInt(time.Now().UnixNano(), 16)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// FileInfo carries the metadata a FileSystem backend knows about a file,
+// mirroring what the HTTP layer needs to set response headers
+type FileInfo struct {
+	ETag          string
+	LastModified  time.Time
+	ContentLength int64
+	ContentRange  string
+}
+
+// FileSystem is implemented by anything that can serve as a backing store
+// for the proxy. rangeHeader is passed through verbatim (e.g. "bytes=0-99")
+// so backends that support partial reads can honour it; backends that don't
+// may ignore it and return the whole file
+type FileSystem interface {
+	Open(path string, rangeHeader string) (io.ReadCloser, *FileInfo, error)
+	Create(path string, body io.Reader) (*FileInfo, error)
+	Remove(path string) error
+	Stat(path string) (*FileInfo, error)
+}
+
+// ListEntry describes a single object returned by a Lister
+type ListEntry struct {
+	Key          string
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// ListResult is the outcome of a Lister.List call
+type ListResult struct {
+	Contents              []ListEntry
+	CommonPrefixes        []string
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// Lister is implemented by backends that can enumerate their contents,
+// letting the S3 compatibility mode translate ListObjectsV2 requests into it
+type Lister interface {
+	List(prefix, delimiter, continuationToken string, maxKeys int64) (*ListResult, error)
+}
+
+// ConditionalStater is implemented by backends that can revalidate a cached
+// ETag without transferring the object body again. notModified is true when
+// the backend confirms etag still matches its current copy of path
+type ConditionalStater interface {
+	StatIfNoneMatch(path, etag string) (info *FileInfo, notModified bool, err error)
+}
+
+// FileSystemFactory builds a FileSystem. Factories are looked up by name
+// from the BACKEND env var, in the spirit of go4.org/wkfs
+type FileSystemFactory func() (FileSystem, error)
+
+var backends = map[string]FileSystemFactory{}
+
+// RegisterBackend makes a FileSystem available under name. Call this from
+// an init() function so downstream users can compile in additional backends
+// (GCS, Azure, Vault, ...) without forking this package
+func RegisterBackend(name string, factory FileSystemFactory) {
+	backends[name] = factory
+}
+
+// newFileSystem builds the FileSystem registered under name
+func newFileSystem(name string) (FileSystem, error) {
+	factory, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("no backend registered for %q", name)
+	}
+	return factory()
+}